@@ -4,8 +4,10 @@
 package watchers
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/cilium/cilium/pkg/envoy"
 	"github.com/cilium/cilium/pkg/loadbalancer"
@@ -15,52 +17,359 @@ import (
 	"github.com/cilium/cilium/pkg/slices"
 )
 
-// EnvoyServiceBackendSyncer syncs the backends of a Service as Endpoints to the Envoy L7 proxy.
-type EnvoyServiceBackendSyncer struct {
+// L7ProxyAdapter is implemented by every L7 proxy backend that a Service's backends can be
+// fanned out to. The embedded Envoy XDS server is the default, in-tree adapter, but additional
+// adapters (e.g. a different xDS-speaking proxy, or a file-based sink for testing) can be
+// registered at agent startup so Cilium's Service->Backend reconciliation isn't coupled to the
+// embedded Envoy build.
+type L7ProxyAdapter interface {
+	// Name identifies the adapter, and is what CECs reference via BackendSyncConfig.Adapters.
+	Name() string
+	UpsertEndpoints(svcName loadbalancer.ServiceName, backends map[string]map[Locality]LocalityEndpoints) error
+	DeleteEndpoints(svcName loadbalancer.ServiceName) error
+}
+
+// EnvoyAdapterName is the name of the default, in-tree L7ProxyAdapter backed by the Envoy XDS
+// server. CECs that don't specify BackendSyncConfig.Adapters are fanned out to this adapter.
+const EnvoyAdapterName = "Envoy"
+
+// envoyAdapter adapts envoy.XDSServer to the L7ProxyAdapter interface.
+type envoyAdapter struct {
 	envoyXdsServer envoy.XDSServer
+}
+
+func (*envoyAdapter) Name() string {
+	return EnvoyAdapterName
+}
+
+func (a *envoyAdapter) UpsertEndpoints(svcName loadbalancer.ServiceName, backends map[string]map[Locality]LocalityEndpoints) error {
+	return a.envoyXdsServer.UpsertEnvoyEndpoints(svcName, backends)
+}
+
+func (a *envoyAdapter) DeleteEndpoints(svcName loadbalancer.ServiceName) error {
+	return a.envoyXdsServer.UpsertEnvoyEndpoints(svcName, map[string]map[Locality]LocalityEndpoints{})
+}
+
+// Locality identifies where a backend runs, derived from the topology.kubernetes.io/region,
+// topology.kubernetes.io/zone and topology.kubernetes.io/subzone labels of its node. The zero
+// value means the backend's locality is unknown, or that locality-aware routing is disabled.
+type Locality struct {
+	Region  string
+	Zone    string
+	Subzone string
+}
+
+// LocalityEndpoints is the set of backends for one Locality, along with the Envoy priority
+// that locality group should be published with: Envoy load-balances within the lowest-numbered
+// priority that has healthy endpoints, and only spills over to a higher-numbered priority once
+// it doesn't. Same-priority localities (the default, when no override applies) are all eligible
+// together, i.e. no zone preference.
+type LocalityEndpoints struct {
+	Backends []*loadbalancer.Backend
+	Priority uint32
+}
+
+// NodeLocalityResolver resolves the Locality of the node a backend runs on, so backends can be
+// grouped into locality-aware Envoy LocalityLbEndpoints. It's injected so tests can mock node
+// label lookups without a real Kubernetes client.
+type NodeLocalityResolver interface {
+	// GetLocality returns the Locality of nodeName, and false if it isn't known (e.g. the
+	// node hasn't been observed yet, or carries no topology labels).
+	GetLocality(nodeName string) (Locality, bool)
+}
+
+// backendDrainGracePeriod is how long a backend that has gone Terminating (or
+// disappeared from the Service's backend list entirely) keeps being published to
+// Envoy with a zero weight, so that in-flight requests have a chance to complete
+// instead of being reset the moment Kubernetes removes the endpoint.
+const backendDrainGracePeriod = 30 * time.Second
+
+// L7BackendSyncer syncs the backends of a Service as Endpoints to one or more registered L7
+// proxy adapters (see L7ProxyAdapter). A single Service can be fanned out to several adapters
+// at once; which ones is decided per CEC via BackendSyncConfig.Adapters.
+type L7BackendSyncer struct {
+	adaptersMutex lock.RWMutex
+	adapters      map[string]L7ProxyAdapter
+
+	// nodeLocalityResolver resolves the Locality of a backend's node for locality-aware
+	// endpoint grouping. May be nil, in which case locality-aware routing is disabled
+	// regardless of any CEC's opt-in.
+	nodeLocalityResolver NodeLocalityResolver
 
 	l7lbSvcsMutex lock.RWMutex
 	l7lbSvcs      map[loadbalancer.ServiceName]*backendSyncInfo
 }
 
-var _ service.BackendSyncer = &EnvoyServiceBackendSyncer{}
+var _ service.BackendSyncer = &L7BackendSyncer{}
 
-func (*EnvoyServiceBackendSyncer) ProxyName() string {
-	return "Envoy"
+// ProxyName identifies this service.BackendSyncer to the rest of the service reconciliation
+// code (e.g. in logs). It deliberately doesn't name a single proxy, since a Service's backends
+// may be fanned out to several L7ProxyAdapters at once (see BackendSyncConfig.Adapters).
+func (*L7BackendSyncer) ProxyName() string {
+	return "L7 Proxy"
 }
 
-func NewEnvoyServiceBackendSyncer(envoyXdsServer envoy.XDSServer) *EnvoyServiceBackendSyncer {
-	return &EnvoyServiceBackendSyncer{
-		envoyXdsServer: envoyXdsServer,
-		l7lbSvcs:       map[loadbalancer.ServiceName]*backendSyncInfo{},
+// NewEnvoyServiceBackendSyncer returns an L7BackendSyncer with the Envoy XDS server registered
+// as its only, default adapter. Additional adapters can be registered with RegisterAdapter,
+// typically during agent startup.
+func NewEnvoyServiceBackendSyncer(envoyXdsServer envoy.XDSServer, nodeLocalityResolver NodeLocalityResolver) *L7BackendSyncer {
+	r := &L7BackendSyncer{
+		adapters:             map[string]L7ProxyAdapter{},
+		nodeLocalityResolver: nodeLocalityResolver,
+		l7lbSvcs:             map[loadbalancer.ServiceName]*backendSyncInfo{},
 	}
+	r.RegisterAdapter(&envoyAdapter{envoyXdsServer: envoyXdsServer})
+	return r
 }
 
-func (r *EnvoyServiceBackendSyncer) Sync(svc *loadbalancer.SVC) error {
-	r.l7lbSvcsMutex.RLock()
-	l7lbInfo, exists := r.l7lbSvcs[svc.Name]
-	r.l7lbSvcsMutex.RUnlock()
+// RegisterAdapter adds adapter to the set of L7 proxy adapters backends can be fanned out to.
+// It's safe to call concurrently with Sync.
+func (r *L7BackendSyncer) RegisterAdapter(adapter L7ProxyAdapter) {
+	r.adaptersMutex.Lock()
+	defer r.adaptersMutex.Unlock()
 
+	r.adapters[adapter.Name()] = adapter
+}
+
+func (r *L7BackendSyncer) Sync(svc *loadbalancer.SVC) error {
+	svcLabel := svc.Name.String()
+	start := time.Now()
+
+	err := r.sync(svc)
+
+	l7lbSyncDuration.WithLabelValues(svcLabel).Observe(time.Since(start).Seconds())
+	if err != nil {
+		l7lbSyncTotal.WithLabelValues(svcLabel, "error").Inc()
+		l7lbLastSyncSuccess.WithLabelValues(svcLabel).Set(0)
+		return err
+	}
+
+	l7lbSyncTotal.WithLabelValues(svcLabel, "success").Inc()
+	l7lbLastSyncSuccess.WithLabelValues(svcLabel).Set(1)
+	return nil
+}
+
+func (r *L7BackendSyncer) sync(svc *loadbalancer.SVC) error {
+	r.l7lbSvcsMutex.Lock()
+	l7lbInfo, exists := r.l7lbSvcs[svc.Name]
 	if !exists {
+		r.l7lbSvcsMutex.Unlock()
 		return nil
 	}
-
-	// Filter backend based on list of port numbers, then upsert backends
-	// as Envoy endpoints
-	be := filterServiceBackends(svc, l7lbInfo.GetAllFrontendPorts())
+	backends := applyBackendWeights(svc.Backends, l7lbInfo.GetMergedBackendWeights())
+	liveBackends, drainingBackends := r.withDrainingBackends(l7lbInfo, backends, l7lbInfo.GetDrainGracePeriod())
+	drainingAddrs := make(map[loadbalancer.L3n4Addr]struct{}, len(drainingBackends))
+	for _, be := range drainingBackends {
+		drainingAddrs[be.L3n4Addr] = struct{}{}
+	}
+	localityAware := l7lbInfo.LocalityWeightedLBEnabled()
+	localityPriorities := l7lbInfo.GetMergedLocalityPriorities()
+	adapterNames := l7lbInfo.GetAdapterNames()
+	r.l7lbSvcsMutex.Unlock()
+
+	// svcWithLiveBackends carries only the Service's live backends. drainingBackends are kept
+	// separate and merged in by filterServiceBackends after preferred-backend filtering, so a
+	// backend that's draining but not itself Preferred isn't silently dropped by
+	// filterPreferredBackends whenever the Service has any Preferred backends at all.
+	svcWithLiveBackends := *svc
+	svcWithLiveBackends.Backends = liveBackends
+
+	// Filter backend based on list of port numbers, group by locality, then upsert
+	// backends into every adapter this service was registered against.
+	be := filterServiceBackends(&svcWithLiveBackends, drainingBackends, l7lbInfo.GetAllFrontendPorts(), localityAware, r.nodeLocalityResolver, localityPriorities)
+	recordBackendMetrics(svc.Name.String(), be, drainingAddrs)
 
 	log.
 		WithField("filteredBackends", be).
 		WithField(logfields.L7LBFrontendPorts, l7lbInfo.GetAllFrontendPorts()).
-		Debug("Upsert envoy endpoints")
-	if err := r.envoyXdsServer.UpsertEnvoyEndpoints(svc.Name, be); err != nil {
-		return fmt.Errorf("failed to update backends in Envoy: %w", err)
+		WithField("adapters", adapterNames).
+		Debug("Upsert L7 proxy endpoints")
+
+	r.adaptersMutex.RLock()
+	defer r.adaptersMutex.RUnlock()
+
+	var errs error
+	for _, name := range adapterNames {
+		adapter, ok := r.adapters[name]
+		if !ok {
+			errs = errors.Join(errs, fmt.Errorf("no L7 proxy adapter registered with name %q", name))
+			l7lbSyncErrorsTotal.WithLabelValues("unknown_adapter").Inc()
+			continue
+		}
+		if err := adapter.UpsertEndpoints(svcWithLiveBackends.Name, be); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to update backends in %s: %w", name, err))
+			l7lbSyncErrorsTotal.WithLabelValues("adapter_upsert").Inc()
+		}
 	}
 
-	return nil
+	return errs
+}
+
+// recordBackendMetrics updates the per-service/port/state backend gauge from the result of
+// filterServiceBackends. A backend counts as draining if its address is in drainingAddrs (i.e.
+// withDrainingBackends is still publishing it at zero weight past its normal lifetime), not
+// merely because its weight is zero — a zero BackendWeights override is a permanent, healthy
+// state (e.g. a disabled canary) and must not be conflated with draining.
+func recordBackendMetrics(svcLabel string, be map[string]map[Locality]LocalityEndpoints, drainingAddrs map[loadbalancer.L3n4Addr]struct{}) {
+	for port, byLocality := range be {
+		active, draining := 0, 0
+		for _, loc := range byLocality {
+			for _, backend := range loc.Backends {
+				if _, isDraining := drainingAddrs[backend.L3n4Addr]; isDraining {
+					draining++
+				} else {
+					active++
+				}
+			}
+		}
+		l7lbBackends.WithLabelValues(svcLabel, port, "active").Set(float64(active))
+		l7lbBackends.WithLabelValues(svcLabel, port, "draining").Set(float64(draining))
+	}
+}
+
+// withDrainingBackends splits newBackends (the Service's current backend list) into the live
+// set (Terminating backends removed) and a separate draining set: backends that recently went
+// Terminating or disappeared from the Service entirely, kept at zero weight until gracePeriod
+// elapses so in-flight requests have a chance to complete. The two are kept separate, rather
+// than merged into one list, so callers can merge the draining set back in themselves after
+// any preferred-backend filtering (see filterServiceBackends) — a draining backend must be
+// published regardless of whether it's itself Preferred. It must be called with l7lbSvcsMutex
+// held, since it updates l7lbInfo's draining bookkeeping.
+func (r *L7BackendSyncer) withDrainingBackends(l7lbInfo *backendSyncInfo, newBackends []*loadbalancer.Backend, gracePeriod time.Duration) (live []*loadbalancer.Backend, draining []*loadbalancer.Backend) {
+	now := time.Now()
+
+	current := make(map[loadbalancer.L3n4Addr]*loadbalancer.Backend, len(newBackends))
+	for _, be := range newBackends {
+		current[be.L3n4Addr] = be
+	}
+
+	if l7lbInfo.drainingBackends == nil {
+		l7lbInfo.drainingBackends = map[loadbalancer.L3n4Addr]drainingBackend{}
+	}
+
+	// Backends still reported by the Service but already Terminating start draining
+	// immediately.
+	for addr, be := range current {
+		if be.State != loadbalancer.BackendStateTerminating {
+			continue
+		}
+		if _, alreadyDraining := l7lbInfo.drainingBackends[addr]; !alreadyDraining {
+			l7lbInfo.drainingBackends[addr] = newDrainingBackend(be, now, gracePeriod)
+		}
+	}
+
+	// Backends that disappeared from the Service entirely (e.g. the Pod and its
+	// Kubernetes Endpoint were deleted outright) also keep draining rather than
+	// vanishing from Envoy the moment they're gone.
+	for addr, prev := range l7lbInfo.previousBackends {
+		if _, stillPresent := current[addr]; stillPresent {
+			continue
+		}
+		if _, alreadyDraining := l7lbInfo.drainingBackends[addr]; !alreadyDraining {
+			l7lbInfo.drainingBackends[addr] = newDrainingBackend(prev, now, gracePeriod)
+		}
+	}
+
+	live = make([]*loadbalancer.Backend, 0, len(newBackends))
+	for _, be := range newBackends {
+		if be.State != loadbalancer.BackendStateTerminating {
+			live = append(live, be)
+		}
+	}
+
+	draining = make([]*loadbalancer.Backend, 0, len(l7lbInfo.drainingBackends))
+	for addr, d := range l7lbInfo.drainingBackends {
+		if be, backAndHealthy := current[addr]; backAndHealthy && be.State != loadbalancer.BackendStateTerminating {
+			// The backend came back; stop draining it.
+			delete(l7lbInfo.drainingBackends, addr)
+			continue
+		}
+		if now.After(d.deadline) {
+			delete(l7lbInfo.drainingBackends, addr)
+			continue
+		}
+		draining = append(draining, d.backend)
+	}
+
+	l7lbInfo.previousBackends = current
+
+	return live, draining
+}
+
+// applyBackendWeights overrides Weight on any backend whose address (be.L3n4Addr.String(), the
+// only thing that uniquely identifies one backend — NodeName is shared by every Pod on that
+// node) matches a key in weights, which is merged from the backendWeights annotation of the
+// CECs using this Service (see backendSyncCECInfo.backendWeights). This lets canary rollouts
+// and A/B splits be driven through Envoy's load_balancing_weight without separate Services.
+func applyBackendWeights(backends []*loadbalancer.Backend, weights map[string]uint16) []*loadbalancer.Backend {
+	if len(weights) == 0 {
+		return backends
+	}
+
+	result := make([]*loadbalancer.Backend, len(backends))
+	for i, be := range backends {
+		w, ok := weights[be.L3n4Addr.String()]
+		if !ok {
+			result[i] = be
+			continue
+		}
+		weighted := *be
+		weighted.Weight = w
+		result[i] = &weighted
+	}
+
+	return result
 }
 
-func (r *EnvoyServiceBackendSyncer) RegisterServiceUsageInCEC(svcName loadbalancer.ServiceName, resourceName service.L7LBResourceName, frontendPorts []string) {
+// newDrainingBackend returns a zero-weight copy of be to publish to Envoy until gracePeriod
+// elapses.
+func newDrainingBackend(be *loadbalancer.Backend, now time.Time, gracePeriod time.Duration) drainingBackend {
+	draining := *be
+	draining.Weight = 0
+	return drainingBackend{
+		backend:  &draining,
+		deadline: now.Add(gracePeriod),
+	}
+}
+
+// BackendSyncConfig configures how a single CEC's reference to a Service's backends is synced.
+type BackendSyncConfig struct {
+	// FrontendPorts is the list of front-end ports of the upstream service/cluster, used
+	// for filtering applicable endpoints. If nil, all the available backends will be used.
+	FrontendPorts []string
+
+	// BackendWeights optionally overrides load_balancing_weight on backends, keyed by each
+	// backend's L3n4Addr.String() (see backendSyncCECInfo.backendWeights).
+	BackendWeights map[string]uint16
+
+	// LocalityWeightedLBEnabled opts this CEC's service into locality-aware endpoint
+	// grouping (see Locality and NodeLocalityResolver).
+	LocalityWeightedLBEnabled bool
+
+	// LocalityPriorities optionally overrides the Envoy priority each Locality group is
+	// published with, so that e.g. same-zone endpoints (priority 0) are preferred over
+	// cross-zone ones (priority 1), with Envoy only failing over to a higher-numbered
+	// priority once the lower one has no healthy endpoints. Localities with no entry
+	// default to priority 0. Only meaningful when LocalityWeightedLBEnabled is set.
+	LocalityPriorities map[Locality]uint32
+
+	// Adapters is the set of L7ProxyAdapter names this CEC's backends should be fanned out
+	// to. If empty, defaults to EnvoyAdapterName.
+	Adapters []string
+
+	// DrainGracePeriod overrides how long a backend that went Terminating, or disappeared
+	// from the Service entirely, keeps being published at zero weight. If zero, defaults
+	// to backendDrainGracePeriod.
+	DrainGracePeriod time.Duration
+}
+
+func (r *L7BackendSyncer) RegisterServiceUsageInCEC(svcName loadbalancer.ServiceName, resourceName service.L7LBResourceName, frontendPorts []string) {
+	r.RegisterServiceUsageInCECWithConfig(svcName, resourceName, BackendSyncConfig{FrontendPorts: frontendPorts})
+}
+
+// RegisterServiceUsageInCECWithConfig is like RegisterServiceUsageInCEC, but additionally
+// accepts weight overrides, locality-awareness, and the set of L7 proxy adapters cfg applies to.
+func (r *L7BackendSyncer) RegisterServiceUsageInCECWithConfig(svcName loadbalancer.ServiceName, resourceName service.L7LBResourceName, cfg BackendSyncConfig) {
 	r.l7lbSvcsMutex.Lock()
 	defer r.l7lbSvcsMutex.Unlock()
 
@@ -75,22 +384,33 @@ func (r *EnvoyServiceBackendSyncer) RegisterServiceUsageInCEC(svcName loadbalanc
 	}
 
 	l7lbInfo.backendRefs[resourceName] = backendSyncCECInfo{
-		frontendPorts: frontendPorts,
+		frontendPorts:             cfg.FrontendPorts,
+		backendWeights:            cfg.BackendWeights,
+		localityWeightedLBEnabled: cfg.LocalityWeightedLBEnabled,
+		localityPriorities:        cfg.LocalityPriorities,
+		adapterNames:              cfg.Adapters,
+		drainGracePeriod:          cfg.DrainGracePeriod,
 	}
 
 	r.l7lbSvcs[svcName] = l7lbInfo
+	l7lbRegisteredServices.Set(float64(len(r.l7lbSvcs)))
 }
 
-func (r *EnvoyServiceBackendSyncer) DeregisterServiceUsageInCEC(svcName loadbalancer.ServiceName, resourceName service.L7LBResourceName) bool {
+func (r *L7BackendSyncer) DeregisterServiceUsageInCEC(svcName loadbalancer.ServiceName, resourceName service.L7LBResourceName) bool {
 	r.l7lbSvcsMutex.Lock()
-	defer r.l7lbSvcsMutex.Unlock()
 
 	l7lbInfo, exists := r.l7lbSvcs[svcName]
 
 	if !exists {
+		r.l7lbSvcsMutex.Unlock()
 		return false
 	}
 
+	// Capture the adapters this CEC fanned out to before removing its backendRefs entry,
+	// since GetAdapterNames() falls back to {EnvoyAdapterName} once backendRefs is empty —
+	// computing it after the delete below would always report the default adapter.
+	adapterNames := l7lbInfo.GetAdapterNames()
+
 	if l7lbInfo.backendRefs != nil {
 		delete(l7lbInfo.backendRefs, resourceName)
 	}
@@ -98,33 +418,132 @@ func (r *EnvoyServiceBackendSyncer) DeregisterServiceUsageInCEC(svcName loadbala
 	// Cleanup service if it's no longer used by any CEC
 	if len(l7lbInfo.backendRefs) == 0 {
 		delete(r.l7lbSvcs, svcName)
+		l7lbRegisteredServices.Set(float64(len(r.l7lbSvcs)))
+		l7lbLastSyncSuccess.DeleteLabelValues(svcName.String())
+		r.l7lbSvcsMutex.Unlock()
+
+		r.deleteEndpointsFromAdapters(svcName, adapterNames)
 		return true
 	}
 
 	r.l7lbSvcs[svcName] = l7lbInfo
+	r.l7lbSvcsMutex.Unlock()
 
 	return false
 }
 
-// filterServiceBackends returns the list of backends based on given front end ports.
+// deleteEndpointsFromAdapters tells every named adapter to drop svcName's endpoints, logging
+// (rather than returning) failures, since there's no longer a CEC reference to retry against.
+func (r *L7BackendSyncer) deleteEndpointsFromAdapters(svcName loadbalancer.ServiceName, adapterNames []string) {
+	r.adaptersMutex.RLock()
+	defer r.adaptersMutex.RUnlock()
+
+	for _, name := range adapterNames {
+		adapter, ok := r.adapters[name]
+		if !ok {
+			continue
+		}
+		if err := adapter.DeleteEndpoints(svcName); err != nil {
+			l7lbSyncErrorsTotal.WithLabelValues("adapter_delete").Inc()
+			log.WithError(err).WithField(logfields.ServiceName, svcName).Errorf("Failed to delete endpoints from %s", name)
+		}
+	}
+}
+
+// filterServiceBackends returns the backends based on given front end ports, grouped by
+// Locality. The returned map is keyed by port name/number, and each port maps its backends
+// grouped by Locality, along with the Envoy priority each locality group should be published
+// with (see LocalityEndpoints and localityPriorities). drainingBackends are bucketed by port
+// the same way, but without preferred-backend filtering, and merged in afterwards — so a
+// backend that's draining but not itself Preferred is still published, instead of being
+// dropped by filterPreferredBackends whenever svc has any Preferred backends at all. When
+// localityAware is false, or resolver is nil, or a backend's node locality isn't known, that
+// backend is grouped under the zero Locality.
+func filterServiceBackends(svc *loadbalancer.SVC, drainingBackends []*loadbalancer.Backend, onlyPorts []string, localityAware bool, resolver NodeLocalityResolver, localityPriorities map[Locality]uint32) map[string]map[Locality]LocalityEndpoints {
+	perPort := filterServiceBackendsByPort(svc, onlyPorts)
+	drainingPerPort := filterBackendsByPort(drainingBackends, svc.Frontend.Port, onlyPorts)
+
+	ports := make(map[string]struct{}, len(perPort)+len(drainingPerPort))
+	for port := range perPort {
+		ports[port] = struct{}{}
+	}
+	for port := range drainingPerPort {
+		ports[port] = struct{}{}
+	}
+
+	res := make(map[string]map[Locality]LocalityEndpoints, len(ports))
+	for port := range ports {
+		merged := make([]*loadbalancer.Backend, 0, len(perPort[port])+len(drainingPerPort[port]))
+		merged = append(merged, perPort[port]...)
+		merged = append(merged, drainingPerPort[port]...)
+		res[port] = groupByLocality(merged, localityAware, resolver, localityPriorities)
+	}
+
+	return res
+}
+
+// groupByLocality groups backends by the Locality of the node they run on, and attaches the
+// Envoy priority localityPriorities configures for each group (0 if unset), so that the lowest-
+// numbered priority with healthy endpoints is preferred and Envoy only spills over to the next
+// one on failure. Backends whose locality can't be determined, or when localityAware is false,
+// are grouped under the zero Locality.
+func groupByLocality(backends []*loadbalancer.Backend, localityAware bool, resolver NodeLocalityResolver, localityPriorities map[Locality]uint32) map[Locality]LocalityEndpoints {
+	grouped := map[Locality][]*loadbalancer.Backend{}
+
+	if !localityAware || resolver == nil {
+		grouped[Locality{}] = backends
+	} else {
+		for _, backend := range backends {
+			locality, ok := resolver.GetLocality(backend.NodeName)
+			if !ok {
+				locality = Locality{}
+			}
+			grouped[locality] = append(grouped[locality], backend)
+		}
+	}
+
+	res := make(map[Locality]LocalityEndpoints, len(grouped))
+	for locality, backends := range grouped {
+		res[locality] = LocalityEndpoints{
+			Backends: backends,
+			Priority: localityPriorities[locality],
+		}
+	}
+
+	return res
+}
+
+// filterServiceBackendsByPort returns the list of backends based on given front end ports.
 // The returned map will have key as port name/number, and value as list of respective backends.
-func filterServiceBackends(svc *loadbalancer.SVC, onlyPorts []string) map[string][]*loadbalancer.Backend {
+func filterServiceBackendsByPort(svc *loadbalancer.SVC, onlyPorts []string) map[string][]*loadbalancer.Backend {
+	return filterBackendsByPort(filterPreferredBackends(svc.Backends), svc.Frontend.Port, onlyPorts)
+}
+
+// filterBackendsByPort buckets backends by front-end port the same way
+// filterServiceBackendsByPort does, but operates on an arbitrary backend slice instead of a
+// Service's Preferred-filtered backend list — used for draining backends, which must always be
+// published regardless of preferred-backend filtering.
+func filterBackendsByPort(backends []*loadbalancer.Backend, frontendPort uint16, onlyPorts []string) map[string][]*loadbalancer.Backend {
+	if len(backends) == 0 {
+		return map[string][]*loadbalancer.Backend{}
+	}
+
 	if len(onlyPorts) == 0 {
 		return map[string][]*loadbalancer.Backend{
-			"*": filterPreferredBackends(svc.Backends),
+			"*": backends,
 		}
 	}
 
 	res := map[string][]*loadbalancer.Backend{}
 	for _, port := range onlyPorts {
 		// check for port number
-		if port == strconv.Itoa(int(svc.Frontend.Port)) {
+		if port == strconv.Itoa(int(frontendPort)) {
 			return map[string][]*loadbalancer.Backend{
-				port: filterPreferredBackends(svc.Backends),
+				port: backends,
 			}
 		}
 		// check for either named port
-		for _, backend := range filterPreferredBackends(svc.Backends) {
+		for _, backend := range backends {
 			if port == backend.FEPortName {
 				res[port] = append(res[port], backend)
 			}
@@ -154,6 +573,22 @@ type backendSyncInfo struct {
 	// Names of the L7 LB resources (e.g. CEC) that need this service's backends to be
 	// synced to to an L7 Loadbalancer.
 	backendRefs map[service.L7LBResourceName]backendSyncCECInfo
+
+	// previousBackends is the backend set observed on the last Sync, keyed by address,
+	// so the next Sync can detect backends that disappeared and should start draining.
+	previousBackends map[loadbalancer.L3n4Addr]*loadbalancer.Backend
+
+	// drainingBackends holds backends that are no longer Active but are still
+	// published to Envoy with a zero weight until their grace period expires.
+	drainingBackends map[loadbalancer.L3n4Addr]drainingBackend
+}
+
+// drainingBackend is a backend that has gone Terminating, or disappeared from the
+// Service entirely, and is still being published to Envoy with a zero weight until
+// deadline so that in-flight requests can complete.
+type drainingBackend struct {
+	backend  *loadbalancer.Backend
+	deadline time.Time
 }
 
 func (r *backendSyncInfo) GetAllFrontendPorts() []string {
@@ -166,10 +601,119 @@ func (r *backendSyncInfo) GetAllFrontendPorts() []string {
 	return slices.SortedUnique(allPorts)
 }
 
+// GetMergedBackendWeights returns the per-backend weight overrides of all the CECs using
+// this service, merged into a single map. If more than one CEC sets a weight for the same
+// backend, the result is unspecified between them.
+func (r *backendSyncInfo) GetMergedBackendWeights() map[string]uint16 {
+	weights := map[string]uint16{}
+
+	for _, info := range r.backendRefs {
+		for name, w := range info.backendWeights {
+			weights[name] = w
+		}
+	}
+
+	return weights
+}
+
+// LocalityWeightedLBEnabled reports whether any of the CECs using this service opted into
+// locality-aware endpoint grouping.
+func (r *backendSyncInfo) LocalityWeightedLBEnabled() bool {
+	for _, info := range r.backendRefs {
+		if info.localityWeightedLBEnabled {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetMergedLocalityPriorities returns the per-locality Envoy priority overrides of all the
+// CECs using this service, merged into a single map. If more than one CEC sets a priority for
+// the same Locality, the result is unspecified between them.
+func (r *backendSyncInfo) GetMergedLocalityPriorities() map[Locality]uint32 {
+	priorities := map[Locality]uint32{}
+
+	for _, info := range r.backendRefs {
+		for locality, p := range info.localityPriorities {
+			priorities[locality] = p
+		}
+	}
+
+	return priorities
+}
+
+// GetDrainGracePeriod returns the drain grace period to use for this service: the largest
+// override set by any of the CECs using it, or backendDrainGracePeriod if none set one.
+func (r *backendSyncInfo) GetDrainGracePeriod() time.Duration {
+	period := time.Duration(0)
+
+	for _, info := range r.backendRefs {
+		if info.drainGracePeriod > period {
+			period = info.drainGracePeriod
+		}
+	}
+
+	if period == 0 {
+		return backendDrainGracePeriod
+	}
+
+	return period
+}
+
+// GetAdapterNames returns the set of L7ProxyAdapter names this service's backends should be
+// fanned out to, merged across all the CECs using it. A CEC that doesn't specify any adapters
+// contributes EnvoyAdapterName, and {EnvoyAdapterName} is also returned when no CEC uses it.
+func (r *backendSyncInfo) GetAdapterNames() []string {
+	names := map[string]struct{}{}
+
+	for _, info := range r.backendRefs {
+		if len(info.adapterNames) == 0 {
+			names[EnvoyAdapterName] = struct{}{}
+			continue
+		}
+		for _, name := range info.adapterNames {
+			names[name] = struct{}{}
+		}
+	}
+
+	if len(names) == 0 {
+		return []string{EnvoyAdapterName}
+	}
+
+	res := make([]string, 0, len(names))
+	for name := range names {
+		res = append(res, name)
+	}
+
+	return slices.SortedUnique(res)
+}
+
 type backendSyncCECInfo struct {
 	// List of front-end ports of upstream service/cluster, which will be used for
 	// filtering applicable endpoints.
 	//
 	// If nil, all the available backends will be used.
 	frontendPorts []string
+
+	// backendWeights is an optional map from the CEC's backendWeights annotation, keyed by
+	// each backend's L3n4Addr.String(), overriding the load_balancing_weight of matching
+	// backends. If nil, backends keep their Service-reported weight.
+	backendWeights map[string]uint16
+
+	// localityWeightedLBEnabled opts this CEC's service into locality-aware endpoint
+	// grouping (see Locality and NodeLocalityResolver).
+	localityWeightedLBEnabled bool
+
+	// localityPriorities optionally overrides the Envoy priority for specific Locality
+	// groups (see BackendSyncConfig.LocalityPriorities).
+	localityPriorities map[Locality]uint32
+
+	// adapterNames is the set of L7ProxyAdapter names this CEC wants the service's
+	// backends fanned out to. If nil, defaults to EnvoyAdapterName.
+	adapterNames []string
+
+	// drainGracePeriod overrides backendDrainGracePeriod for this CEC's service. Zero
+	// means no override.
+	drainGracePeriod time.Duration
 }
\ No newline at end of file
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package watchers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/cilium/cilium/pkg/metrics"
+)
+
+const l7lbSubsystem = "l7lb"
+
+var (
+	// l7lbSyncTotal counts every Sync attempt by the Service it was for and whether it
+	// succeeded or failed.
+	l7lbSyncTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: l7lbSubsystem,
+		Name:      "sync_total",
+		Help:      "Number of L7LB backend sync attempts",
+	}, []string{"service", "result"})
+
+	// l7lbSyncDuration observes how long each Sync call to the L7 proxy took.
+	l7lbSyncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: l7lbSubsystem,
+		Name:      "sync_duration_seconds",
+		Help:      "Duration of L7LB backend sync calls",
+	}, []string{"service"})
+
+	// l7lbSyncErrorsTotal counts L7 proxy adapter failures by reason, both during Sync and
+	// when a deregistered Service's endpoints are deleted.
+	l7lbSyncErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: l7lbSubsystem,
+		Name:      "sync_errors_total",
+		Help:      "Number of L7LB backend sync errors",
+	}, []string{"reason"})
+
+	// l7lbBackends is the number of backends last published to the L7 proxy, by Service,
+	// port and state (active or draining).
+	l7lbBackends = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: l7lbSubsystem,
+		Name:      "backends",
+		Help:      "Number of backends synced to the L7 proxy",
+	}, []string{"service", "port", "state"})
+
+	// l7lbRegisteredServices is the number of Services currently registered for L7LB
+	// backend syncing.
+	l7lbRegisteredServices = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: l7lbSubsystem,
+		Name:      "registered_services",
+		Help:      "Number of Services registered for L7LB backend syncing",
+	})
+
+	// l7lbLastSyncSuccess indicates whether the last Sync attempt for a Service
+	// succeeded (1) or failed (0), so that stuck reconciliation can be alerted on
+	// without scraping controller logs.
+	l7lbLastSyncSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: l7lbSubsystem,
+		Name:      "last_sync_success",
+		Help:      "Whether the last L7LB backend sync for a Service succeeded",
+	}, []string{"service"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		l7lbSyncTotal,
+		l7lbSyncDuration,
+		l7lbSyncErrorsTotal,
+		l7lbBackends,
+		l7lbRegisteredServices,
+		l7lbLastSyncSuccess,
+	)
+}
@@ -0,0 +1,310 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package watchers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	cmtypes "github.com/cilium/cilium/pkg/clustermesh/types"
+	"github.com/cilium/cilium/pkg/loadbalancer"
+	"github.com/cilium/cilium/pkg/service"
+)
+
+func newTestBackend(addr string, port uint16, nodeName string) *loadbalancer.Backend {
+	return &loadbalancer.Backend{
+		NodeName: nodeName,
+		L3n4Addr: loadbalancer.NewL3n4Addr(loadbalancer.TCP, cmtypes.MustParseAddrCluster(addr), port, loadbalancer.ScopeExternal),
+		Weight:   loadbalancer.DefaultBackendWeight,
+		State:    loadbalancer.BackendStateActive,
+	}
+}
+
+// fakeLocalityResolver resolves node names to Locality from a static map, for tests that don't
+// want to stand up a real Kubernetes client.
+type fakeLocalityResolver map[string]Locality
+
+func (f fakeLocalityResolver) GetLocality(nodeName string) (Locality, bool) {
+	loc, ok := f[nodeName]
+	return loc, ok
+}
+
+// fakeAdapter records every Upsert/Delete call it receives, for assertions.
+type fakeAdapter struct {
+	name      string
+	upserts   map[loadbalancer.ServiceName]map[string]map[Locality]LocalityEndpoints
+	deletions []loadbalancer.ServiceName
+}
+
+func newFakeAdapter(name string) *fakeAdapter {
+	return &fakeAdapter{name: name, upserts: map[loadbalancer.ServiceName]map[string]map[Locality]LocalityEndpoints{}}
+}
+
+func (f *fakeAdapter) Name() string { return f.name }
+
+func (f *fakeAdapter) UpsertEndpoints(svcName loadbalancer.ServiceName, backends map[string]map[Locality]LocalityEndpoints) error {
+	f.upserts[svcName] = backends
+	return nil
+}
+
+func (f *fakeAdapter) DeleteEndpoints(svcName loadbalancer.ServiceName) error {
+	f.deletions = append(f.deletions, svcName)
+	delete(f.upserts, svcName)
+	return nil
+}
+
+func TestApplyBackendWeights_KeyedByAddress(t *testing.T) {
+	beSameNodeA := newTestBackend("10.0.0.1", 80, "node-1")
+	beSameNodeB := newTestBackend("10.0.0.2", 80, "node-1")
+	backends := []*loadbalancer.Backend{beSameNodeA, beSameNodeB}
+
+	weights := map[string]uint16{beSameNodeA.L3n4Addr.String(): 10}
+
+	result := applyBackendWeights(backends, weights)
+
+	require.Equal(t, uint16(10), result[0].Weight, "override should apply to the addressed backend")
+	require.Equal(t, loadbalancer.DefaultBackendWeight, result[1].Weight, "a sibling backend on the same node must keep its own weight")
+}
+
+func TestGroupByLocality_AssignsConfiguredPriority(t *testing.T) {
+	local := newTestBackend("10.0.0.1", 80, "node-local")
+	remote := newTestBackend("10.0.0.2", 80, "node-remote")
+	resolver := fakeLocalityResolver{
+		"node-local":  {Zone: "zone-a"},
+		"node-remote": {Zone: "zone-b"},
+	}
+	priorities := map[Locality]uint32{
+		{Zone: "zone-a"}: 0,
+		{Zone: "zone-b"}: 1,
+	}
+
+	grouped := groupByLocality([]*loadbalancer.Backend{local, remote}, true, resolver, priorities)
+
+	require.Equal(t, uint32(0), grouped[Locality{Zone: "zone-a"}].Priority)
+	require.Equal(t, uint32(1), grouped[Locality{Zone: "zone-b"}].Priority)
+	require.ElementsMatch(t, []*loadbalancer.Backend{local}, grouped[Locality{Zone: "zone-a"}].Backends)
+	require.ElementsMatch(t, []*loadbalancer.Backend{remote}, grouped[Locality{Zone: "zone-b"}].Backends)
+}
+
+func TestGroupByLocality_Disabled(t *testing.T) {
+	local := newTestBackend("10.0.0.1", 80, "node-local")
+	resolver := fakeLocalityResolver{"node-local": {Zone: "zone-a"}}
+
+	grouped := groupByLocality([]*loadbalancer.Backend{local}, false, resolver, nil)
+
+	require.Len(t, grouped, 1)
+	require.Contains(t, grouped, Locality{})
+}
+
+func TestRecordBackendMetrics_ZeroWeightOverrideIsNotDraining(t *testing.T) {
+	svcLabel := "default/zero-weight-canary"
+	canary := newTestBackend("10.0.0.1", 80, "node-1")
+	canary.Weight = 0
+
+	be := map[string]map[Locality]LocalityEndpoints{
+		"80": {Locality{}: {Backends: []*loadbalancer.Backend{canary}}},
+	}
+
+	// No entry in drainingAddrs: this zero-weight backend is an intentional, permanent
+	// override (e.g. a disabled canary), not one of withDrainingBackends' grace-period backends.
+	recordBackendMetrics(svcLabel, be, map[loadbalancer.L3n4Addr]struct{}{})
+
+	require.Equal(t, float64(1), testutil.ToFloat64(l7lbBackends.WithLabelValues(svcLabel, "80", "active")))
+	require.Equal(t, float64(0), testutil.ToFloat64(l7lbBackends.WithLabelValues(svcLabel, "80", "draining")))
+}
+
+func TestRecordBackendMetrics_DrainingBackendIsCountedAsDraining(t *testing.T) {
+	svcLabel := "default/actually-draining"
+	draining := newTestBackend("10.0.0.2", 80, "node-1")
+	draining.Weight = 0
+
+	be := map[string]map[Locality]LocalityEndpoints{
+		"80": {Locality{}: {Backends: []*loadbalancer.Backend{draining}}},
+	}
+
+	recordBackendMetrics(svcLabel, be, map[loadbalancer.L3n4Addr]struct{}{draining.L3n4Addr: {}})
+
+	require.Equal(t, float64(0), testutil.ToFloat64(l7lbBackends.WithLabelValues(svcLabel, "80", "active")))
+	require.Equal(t, float64(1), testutil.ToFloat64(l7lbBackends.WithLabelValues(svcLabel, "80", "draining")))
+}
+
+func TestWithDrainingBackends_TerminatingBackendDrainsUntilDeadline(t *testing.T) {
+	r := &L7BackendSyncer{}
+	info := &backendSyncInfo{}
+
+	terminating := newTestBackend("10.0.0.1", 80, "node-1")
+	terminating.State = loadbalancer.BackendStateTerminating
+
+	live, draining := r.withDrainingBackends(info, []*loadbalancer.Backend{terminating}, time.Minute)
+
+	require.Empty(t, live, "a Terminating backend must not be published as live")
+	require.Len(t, draining, 1)
+	require.Equal(t, uint16(0), draining[0].Weight)
+	require.Equal(t, terminating.L3n4Addr, draining[0].L3n4Addr)
+}
+
+func TestWithDrainingBackends_DisappearedBackendKeepsDraining(t *testing.T) {
+	r := &L7BackendSyncer{}
+	info := &backendSyncInfo{}
+
+	be := newTestBackend("10.0.0.1", 80, "node-1")
+
+	live, draining := r.withDrainingBackends(info, []*loadbalancer.Backend{be}, time.Minute)
+	require.Equal(t, []*loadbalancer.Backend{be}, live)
+	require.Empty(t, draining)
+
+	// The backend disappears from the Service entirely on the next Sync.
+	live, draining = r.withDrainingBackends(info, nil, time.Minute)
+
+	require.Empty(t, live)
+	require.Len(t, draining, 1)
+	require.Equal(t, be.L3n4Addr, draining[0].L3n4Addr)
+	require.Equal(t, uint16(0), draining[0].Weight)
+}
+
+func TestWithDrainingBackends_PrunedAfterGracePeriod(t *testing.T) {
+	r := &L7BackendSyncer{}
+	info := &backendSyncInfo{}
+
+	be := newTestBackend("10.0.0.1", 80, "node-1")
+	be.State = loadbalancer.BackendStateTerminating
+
+	_, draining := r.withDrainingBackends(info, []*loadbalancer.Backend{be}, time.Millisecond)
+	require.Len(t, draining, 1)
+
+	time.Sleep(10 * time.Millisecond)
+
+	_, draining = r.withDrainingBackends(info, nil, time.Millisecond)
+	require.Empty(t, draining, "a backend must be pruned once its grace period has elapsed")
+}
+
+func TestWithDrainingBackends_BackendReturnsBeforeExpiry(t *testing.T) {
+	r := &L7BackendSyncer{}
+	info := &backendSyncInfo{}
+
+	be := newTestBackend("10.0.0.1", 80, "node-1")
+	be.State = loadbalancer.BackendStateTerminating
+
+	_, draining := r.withDrainingBackends(info, []*loadbalancer.Backend{be}, time.Minute)
+	require.Len(t, draining, 1)
+
+	recovered := newTestBackend("10.0.0.1", 80, "node-1")
+	live, draining := r.withDrainingBackends(info, []*loadbalancer.Backend{recovered}, time.Minute)
+
+	require.Equal(t, []*loadbalancer.Backend{recovered}, live)
+	require.Empty(t, draining, "a backend that's become healthy again must stop draining")
+}
+
+func TestGetDrainGracePeriod(t *testing.T) {
+	info := &backendSyncInfo{}
+	require.Equal(t, backendDrainGracePeriod, info.GetDrainGracePeriod(), "falls back to the default when no CEC overrides it")
+
+	info.backendRefs = map[service.L7LBResourceName]backendSyncCECInfo{
+		{Name: "a"}: {drainGracePeriod: 5 * time.Second},
+		{Name: "b"}: {drainGracePeriod: 10 * time.Second},
+	}
+	require.Equal(t, 10*time.Second, info.GetDrainGracePeriod(), "the largest override across the CECs using this service wins")
+}
+
+// TestFilterServiceBackends_DrainingBackendSurvivesPreferredFiltering guards against the bug
+// where a draining backend got merged into the Service's backend list before
+// filterPreferredBackends ran, so it was silently dropped whenever the Service had any
+// Preferred backends at all.
+func TestFilterServiceBackends_DrainingBackendSurvivesPreferredFiltering(t *testing.T) {
+	preferred := newTestBackend("10.0.0.1", 80, "node-1")
+	preferred.Preferred = loadbalancer.Preferred(true)
+
+	draining := newTestBackend("10.0.0.2", 80, "node-2")
+	draining.Weight = 0
+
+	svc := &loadbalancer.SVC{
+		Backends: []*loadbalancer.Backend{preferred},
+	}
+
+	be := filterServiceBackends(svc, []*loadbalancer.Backend{draining}, nil, false, nil, nil)
+
+	require.ElementsMatch(t, []*loadbalancer.Backend{preferred, draining}, be["*"][Locality{}].Backends,
+		"the draining backend must survive even though the Service has a Preferred backend")
+}
+
+// erroringAdapter always fails UpsertEndpoints, for testing Sync's error-reporting metrics.
+type erroringAdapter struct {
+	name string
+}
+
+func (e *erroringAdapter) Name() string { return e.name }
+
+func (e *erroringAdapter) UpsertEndpoints(loadbalancer.ServiceName, map[string]map[Locality]LocalityEndpoints) error {
+	return errors.New("upsert failed")
+}
+
+func (e *erroringAdapter) DeleteEndpoints(loadbalancer.ServiceName) error { return nil }
+
+// TestSync_AdapterErrorIsReportedInMetrics covers the metrics this request added to let
+// operators "alert on stuck reconciliation": a failing adapter must flip l7lbLastSyncSuccess to
+// 0, count against l7lbSyncTotal{result="error"} and l7lbSyncErrorsTotal{reason="adapter_upsert"},
+// and still record a sync duration observation.
+func TestSync_AdapterErrorIsReportedInMetrics(t *testing.T) {
+	r := &L7BackendSyncer{
+		adapters: map[string]L7ProxyAdapter{},
+		l7lbSvcs: map[loadbalancer.ServiceName]*backendSyncInfo{},
+	}
+	failing := &erroringAdapter{name: "failing-proxy"}
+	r.RegisterAdapter(failing)
+
+	svcName := loadbalancer.NewServiceName("default", "sync-error-svc", "")
+	cec := service.L7LBResourceName{Name: "cec", Namespace: "default"}
+	r.RegisterServiceUsageInCECWithConfig(svcName, cec, BackendSyncConfig{Adapters: []string{"failing-proxy"}})
+
+	svc := &loadbalancer.SVC{
+		Name:     svcName,
+		Backends: []*loadbalancer.Backend{newTestBackend("10.0.0.1", 80, "node-1")},
+	}
+
+	errsBefore := testutil.ToFloat64(l7lbSyncErrorsTotal.WithLabelValues("adapter_upsert"))
+	durationSamplesBefore := testutil.CollectAndCount(l7lbSyncDuration)
+
+	err := r.Sync(svc)
+
+	require.Error(t, err)
+	require.Equal(t, float64(1), testutil.ToFloat64(l7lbSyncTotal.WithLabelValues(svcName.String(), "error")))
+	require.Equal(t, float64(0), testutil.ToFloat64(l7lbLastSyncSuccess.WithLabelValues(svcName.String())))
+	require.Equal(t, errsBefore+1, testutil.ToFloat64(l7lbSyncErrorsTotal.WithLabelValues("adapter_upsert")))
+	require.Equal(t, durationSamplesBefore+1, testutil.CollectAndCount(l7lbSyncDuration),
+		"Sync must record a duration observation even when the adapter call fails")
+}
+
+// TestDeregisterServiceUsageInCEC_NotifiesOnlyTheConfiguredAdapters registers a Service for a
+// single CEC that is fanned out to a non-default adapter. Deregistering that last CEC must delete
+// endpoints from the adapter the Service was actually using, not silently fall back to the
+// default Envoy adapter.
+func TestDeregisterServiceUsageInCEC_NotifiesOnlyTheConfiguredAdapters(t *testing.T) {
+	r := &L7BackendSyncer{
+		adapters: map[string]L7ProxyAdapter{},
+		l7lbSvcs: map[loadbalancer.ServiceName]*backendSyncInfo{},
+	}
+	other := newFakeAdapter("other-proxy")
+	r.RegisterAdapter(other)
+	envoyDefault := newFakeAdapter(EnvoyAdapterName)
+	r.RegisterAdapter(envoyDefault)
+
+	svcName := loadbalancer.NewServiceName("default", "my-svc", "")
+	cecA := service.L7LBResourceName{Name: "cec-a", Namespace: "default"}
+
+	r.RegisterServiceUsageInCECWithConfig(svcName, cecA, BackendSyncConfig{
+		Adapters: []string{"other-proxy"},
+	})
+
+	removed := r.DeregisterServiceUsageInCEC(svcName, cecA)
+
+	require.True(t, removed)
+	require.Equal(t, []loadbalancer.ServiceName{svcName}, other.deletions,
+		"the adapter the CEC actually configured must receive the delete")
+	require.Empty(t, envoyDefault.deletions,
+		"the default Envoy adapter wasn't configured by the CEC and must not receive a delete")
+}